@@ -2,6 +2,7 @@
 package dial
 
 import (
+	"container/list"
 	"context"
 	"errors"
 	"math/rand"
@@ -9,11 +10,14 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"golang.org/x/sync/singleflight"
 )
 
 type lookupResult struct {
 	expires time.Time
 	addrs   []string
+	element *list.Element // protected by Cache.lruLock, holds the name
 }
 
 // A Resolver looks up hosts.
@@ -21,50 +25,76 @@ type Resolver interface {
 	LookupHost(ctx context.Context, host string) (addrs []string, err error)
 }
 
+// A TTLResolver looks up hosts and also reports the TTL of the
+// underlying DNS answer, so that Cache.set can honor it instead of the
+// fixed Options.ttl. Resolvers that do not implement TTLResolver fall
+// back to Options.ttl.
+type TTLResolver interface {
+	LookupHostTTL(ctx context.Context, host string) (addrs []string, ttl time.Duration, err error)
+}
+
+// A FamilyResolver looks up hosts restricted to a single address
+// family ("ip4" or "ip6") and reports the TTL of that family's DNS
+// answer, so Cache can resolve and cache A and AAAA records
+// independently. Resolvers that do not implement FamilyResolver fall
+// back to a single merged Resolver/TTLResolver lookup, filtered and
+// reordered per WithAddressFamily afterward.
+type FamilyResolver interface {
+	LookupIPFamily(ctx context.Context, family, host string) (addrs []string, ttl time.Duration, err error)
+}
+
 // Dialer dials
 type Dialer interface {
 	DialContext(ctx context.Context, network, address string) (net.Conn, error)
 }
 
-// Cache is a dialer that caches dns lookups.
+// Cache is a dialer that caches dns lookups. Reads of cached entries
+// are lock-free; lruLock is only taken to insert or evict an entry.
 type Cache struct {
-	lock    sync.RWMutex
-	options Options
-	entries map[string]*lookupResult
+	options  Options
+	entries  sync.Map // name -> *lookupResult
+	lruLock  sync.Mutex
+	lru      *list.List // names, most-recently-set at the front
+	stopCh   chan struct{}
+	stopOnce sync.Once
+	group    singleflight.Group
 }
 
 // Options is used to create a new cache dialer.
 type Options struct {
-	ttl      time.Duration // override ttl
-	maxItems int
-	resolver Resolver
-	dialer   Dialer
+	ttl             time.Duration // override ttl
+	maxItems        int
+	resolver        Resolver
+	dialer          Dialer
+	dialAllAddrs    bool
+	refreshInterval time.Duration
+	lookupTimeout   time.Duration
+	minTTL          time.Duration
+	maxTTL          time.Duration
+	family          string
 }
 
 // OptionFunc is used to set options when creating a new cache dialer
 type OptionFunc func(*Options)
 
-// TODO: support using ttl of item.
-// look at "github.com/miekg/dns" or a higher level package
 var defaultOptions = Options{
-	ttl:      time.Second * 10,
-	maxItems: 1024,
+	ttl:           time.Second * 10,
+	maxItems:      1024,
+	lookupTimeout: time.Second * 5,
 }
 
 // New returns a new cache
 func New(options ...OptionFunc) *Cache {
 	c := Cache{
 		options: defaultOptions,
+		stopCh:  make(chan struct{}),
+		lru:     list.New(),
 	}
 
 	for _, o := range options {
 		o(&c.options)
 	}
 
-	if c.options.maxItems > 0 {
-		c.entries = make(map[string]*lookupResult, c.options.maxItems+1)
-	}
-
 	if c.options.resolver == nil {
 		c.options.resolver = net.DefaultResolver
 	}
@@ -73,6 +103,10 @@ func New(options ...OptionFunc) *Cache {
 		c.options.dialer = &net.Dialer{}
 	}
 
+	if c.options.refreshInterval > 0 {
+		go c.refreshLoop()
+	}
+
 	return &c
 }
 
@@ -108,39 +142,178 @@ func WithDialer(d Dialer) OptionFunc {
 	}
 }
 
+// WithDialAllAddrs sets whether DialContext iterates over all cached
+// addresses, in a randomized order, and returns the first successful
+// connection, aggregating errors if all addresses fail.
+// default is false - a single random address is dialed.
+func WithDialAllAddrs(b bool) OptionFunc {
+	return func(o *Options) {
+		o.dialAllAddrs = b
+	}
+}
+
+// WithRefreshInterval enables a background goroutine that periodically
+// re-resolves every name currently in the cache before its ttl expires,
+// so that DialContext never blocks on a slow DNS server during normal
+// operation. default is 0, which disables the background refresher.
+func WithRefreshInterval(d time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.refreshInterval = d
+	}
+}
+
+// WithLookupTimeout bounds each lookup performed by the background
+// refresher. default is 5 seconds. Only used when WithRefreshInterval
+// is set.
+func WithLookupTimeout(d time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.lookupTimeout = d
+	}
+}
+
+// WithMinTTL sets a floor on the ttl used when the configured resolver
+// implements TTLResolver or FamilyResolver. default is 0, which applies
+// no minimum. Has no effect on resolvers that only implement Resolver.
+func WithMinTTL(d time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.minTTL = d
+	}
+}
+
+// WithMaxTTL sets a ceiling on the ttl used when the configured
+// resolver implements TTLResolver or FamilyResolver. default is 0,
+// which applies no maximum. Has no effect on resolvers that only
+// implement Resolver.
+func WithMaxTTL(d time.Duration) OptionFunc {
+	return func(o *Options) {
+		o.maxTTL = d
+	}
+}
+
+// WithAddressFamily sets the preferred address family: "ip4", "ip6",
+// or "ip" (the default), which resolves and merges both, ip4 first.
+// Dialing "tcp4"/"udp4" or "tcp6"/"udp6" always restricts to the
+// family implied by the network, regardless of this setting. With a
+// resolver implementing FamilyResolver, each family is resolved and
+// cached independently; otherwise a single merged lookup is filtered
+// and reordered to honor the preference.
+func WithAddressFamily(family string) OptionFunc {
+	return func(o *Options) {
+		o.family = family
+	}
+}
+
+// Stop shuts down the background refresh goroutine started by
+// WithRefreshInterval, if any. It is safe to call Stop more than once,
+// and safe to call even if no refresher was started.
+func (c *Cache) Stop() {
+	c.stopOnce.Do(func() {
+		close(c.stopCh)
+	})
+}
+
+func (c *Cache) refreshLoop() {
+	ticker := time.NewTicker(c.options.refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stopCh:
+			return
+		case <-ticker.C:
+			c.refresh()
+		}
+	}
+}
+
+// refresh re-resolves every name currently in the cache. A snapshot of
+// the keys is taken up front so a slow lookup does not block inserts.
+// Entries that fail to re-resolve are left in place to avoid thrashing.
+func (c *Cache) refresh() {
+	var names []string
+
+	c.entries.Range(func(k, _ interface{}) bool {
+		names = append(names, k.(string))
+		return true
+	})
+
+	for _, name := range names {
+		c.refreshOne(name)
+	}
+}
+
+func (c *Cache) refreshOne(key string) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.options.lookupTimeout)
+	defer cancel()
+
+	name, family, ok := splitFamilyKey(key)
+	if ok {
+		addrs, ttl, err := c.resolveFamily(ctx, family, name)
+		if err != nil || len(addrs) == 0 {
+			return
+		}
+
+		c.set(key, addrs, ttl)
+		return
+	}
+
+	addrs, ttl, err := c.resolve(ctx, key)
+	if err != nil || len(addrs) == 0 {
+		return
+	}
+
+	c.set(key, addrs, ttl)
+}
+
 // can be changed for tests
 var nowFunc = time.Now
 
+// get is the hot path and never takes lruLock - it is a plain sync.Map
+// load, so concurrent dials never contend with each other or with an
+// in-progress set/evict.
 func (c *Cache) get(name string) ([]string, bool) {
-	now := nowFunc()
-
-	c.lock.RLock()
-	defer c.lock.RUnlock()
+	v, ok := c.entries.Load(name)
+	if !ok {
+		return nil, false
+	}
 
-	if r, ok := c.entries[name]; ok && r.expires.After(now) {
-		return r.addrs, true
+	r := v.(*lookupResult)
+	if !r.expires.After(nowFunc()) {
+		return nil, false
 	}
 
-	return nil, false
+	return r.addrs, true
 }
 
-func (c *Cache) set(name string, addrs []string) {
-	result := lookupResult{
+// set inserts or replaces the entry for name and evicts the least
+// recently set entry once maxItems is exceeded. This is the miss path,
+// so contending on lruLock here is acceptable.
+func (c *Cache) set(name string, addrs []string, ttl time.Duration) {
+	result := &lookupResult{
 		addrs:   addrs,
-		expires: nowFunc().Add(c.options.ttl),
+		expires: nowFunc().Add(ttl),
 	}
 
-	c.lock.Lock()
-	defer c.lock.Unlock()
+	c.lruLock.Lock()
+	defer c.lruLock.Unlock()
+
+	if old, ok := c.entries.Load(name); ok {
+		result.element = old.(*lookupResult).element
+		c.lru.MoveToFront(result.element)
+	} else {
+		result.element = c.lru.PushFront(name)
+	}
 
-	c.entries[name] = &result
+	c.entries.Store(name, result)
 
-	if len(c.entries) > c.options.maxItems {
-		// delete random entry
-		for k := range c.entries {
-			delete(c.entries, k)
+	for c.lru.Len() > c.options.maxItems {
+		oldest := c.lru.Back()
+		if oldest == nil {
 			break
 		}
+
+		c.lru.Remove(oldest)
+		c.entries.Delete(oldest.Value.(string))
 	}
 }
 
@@ -148,7 +321,62 @@ const noSuchHost = "no such host"
 
 var errNoSuchHost = errors.New(noSuchHost)
 
-func (c *Cache) lookup(ctx context.Context, name string) ([]string, error) {
+// lookup resolves name for use with network, honoring the configured
+// address family preference (see WithAddressFamily). If the resolver
+// does not implement FamilyResolver, a single merged lookup is
+// performed and the result is filtered/reordered for network/family
+// afterward; otherwise each family is resolved and cached
+// independently.
+func (c *Cache) lookup(ctx context.Context, network, name string) ([]string, error) {
+	if ip := net.ParseIP(name); ip != nil {
+		return []string{name}, nil
+	}
+
+	families := familiesForNetwork(network, c.options.family)
+
+	if _, ok := c.options.resolver.(FamilyResolver); !ok {
+		addrs, err := c.lookupName(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs = orderByFamily(addrs, families)
+		if len(addrs) == 0 {
+			return nil, errNoSuchHost
+		}
+
+		return addrs, nil
+	}
+
+	var (
+		merged  []string
+		lastErr error
+	)
+
+	for _, family := range families {
+		addrs, err := c.lookupFamily(ctx, family, name)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+
+		merged = append(merged, addrs...)
+	}
+
+	if len(merged) == 0 {
+		if lastErr != nil {
+			return nil, lastErr
+		}
+
+		return nil, errNoSuchHost
+	}
+
+	return merged, nil
+}
+
+// lookupName resolves name via Resolver/TTLResolver, caching the
+// merged result under name.
+func (c *Cache) lookupName(ctx context.Context, name string) ([]string, error) {
 	if c.options.maxItems == 0 || c.options.ttl == 0 {
 		return c.options.resolver.LookupHost(ctx, name)
 	}
@@ -161,34 +389,211 @@ func (c *Cache) lookup(ctx context.Context, name string) ([]string, error) {
 		return addrs, nil
 	}
 
-	if ip := net.ParseIP(name); ip != nil {
-		addrs := []string{name}
-		c.set(name, addrs)
+	addrs, ttl, err := c.resolve(ctx, name)
+	if err != nil {
+		// stdlib net does not expose this, so check with string matching
+		if strings.Contains(err.Error(), noSuchHost) {
+			c.set(name, nil, c.options.ttl)
+			return nil, errNoSuchHost
+		}
+		return nil, err
+	}
+
+	if len(addrs) == 0 {
+		c.set(name, nil, c.options.ttl)
+		return nil, errNoSuchHost
+	}
+
+	c.set(name, addrs, ttl)
+
+	return addrs, nil
+}
+
+// lookupFamily resolves name restricted to family via FamilyResolver,
+// caching the result under a key scoped to (name, family).
+func (c *Cache) lookupFamily(ctx context.Context, family, name string) ([]string, error) {
+	key := familyKey(name, family)
+
+	if c.options.maxItems == 0 || c.options.ttl == 0 {
+		addrs, _, err := c.options.resolver.(FamilyResolver).LookupIPFamily(ctx, family, name)
+		return addrs, err
+	}
+
+	addrs, ok := c.get(key)
+	if ok {
+		if len(addrs) == 0 {
+			return nil, errNoSuchHost
+		}
 		return addrs, nil
 	}
 
-	addrs, err := c.options.resolver.LookupHost(ctx, name)
+	addrs, ttl, err := c.resolveFamily(ctx, family, name)
 	if err != nil {
-		// stdlib net does not expose this, so check with string matching
 		if strings.Contains(err.Error(), noSuchHost) {
-			c.set(name, nil)
+			c.set(key, nil, c.options.ttl)
 			return nil, errNoSuchHost
 		}
+		return nil, err
 	}
 
 	if len(addrs) == 0 {
-		c.set(name, nil)
+		c.set(key, nil, c.options.ttl)
 		return nil, errNoSuchHost
 	}
 
-	c.set(name, addrs)
+	c.set(key, addrs, ttl)
 
 	return addrs, nil
 }
 
+// familyKeyDelim separates the name and family halves of a family
+// cache key. Hostnames cannot contain a NUL byte.
+const familyKeyDelim = "\x00"
+
+func familyKey(name, family string) string {
+	return name + familyKeyDelim + family
+}
+
+func splitFamilyKey(key string) (name, family string, ok bool) {
+	idx := strings.IndexByte(key, 0)
+	if idx < 0 {
+		return "", "", false
+	}
+
+	return key[:idx], key[idx+1:], true
+}
+
+// familiesForNetwork returns the address families lookup should
+// resolve, and the order addresses should be merged/dialed in.
+// Networks that already imply a family win over pref.
+func familiesForNetwork(network, pref string) []string {
+	switch network {
+	case "tcp4", "udp4":
+		return []string{"ip4"}
+	case "tcp6", "udp6":
+		return []string{"ip6"}
+	}
+
+	if pref == "ip6" {
+		return []string{"ip6", "ip4"}
+	}
+
+	return []string{"ip4", "ip6"}
+}
+
+// filterFamily returns the addrs belonging to family ("ip4" or
+// "ip6"), preserving order.
+func filterFamily(addrs []string, family string) []string {
+	var out []string
+
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			continue
+		}
+
+		if (ip.To4() != nil) == (family == "ip4") {
+			out = append(out, addr)
+		}
+	}
+
+	return out
+}
+
+// orderByFamily filters addrs down to a single family, or, when
+// families holds both, reorders addrs so the preferred family comes
+// first.
+func orderByFamily(addrs []string, families []string) []string {
+	if len(families) == 1 {
+		return filterFamily(addrs, families[0])
+	}
+
+	var ordered []string
+
+	for _, family := range families {
+		ordered = append(ordered, filterFamily(addrs, family)...)
+	}
+
+	return ordered
+}
+
+type resolveResult struct {
+	addrs []string
+	ttl   time.Duration
+}
+
+// resolve calls the configured resolver, collapsing concurrent calls
+// for the same name into a single underlying lookup via a
+// singleflight.Group. This group is shared with the background
+// refresher, so a refresh in progress deduplicates with a concurrent
+// miss for the same name.
+//
+// If the configured resolver implements TTLResolver, the returned ttl
+// is the record ttl reported by the resolver, clamped to
+// Options.minTTL/maxTTL. Otherwise it is Options.ttl.
+func (c *Cache) resolve(ctx context.Context, name string) ([]string, time.Duration, error) {
+	v, err, _ := c.group.Do(name, func() (interface{}, error) {
+		if r, ok := c.options.resolver.(TTLResolver); ok {
+			addrs, ttl, err := r.LookupHostTTL(ctx, name)
+			if err != nil {
+				return nil, err
+			}
+
+			return resolveResult{addrs: addrs, ttl: clampTTL(ttl, c.options.minTTL, c.options.maxTTL)}, nil
+		}
+
+		addrs, err := c.options.resolver.LookupHost(ctx, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return resolveResult{addrs: addrs, ttl: c.options.ttl}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := v.(resolveResult)
+	return res.addrs, res.ttl, nil
+}
+
+// resolveFamily calls the configured resolver's FamilyResolver
+// implementation, collapsing concurrent calls for the same (name,
+// family) pair the same way resolve does for plain lookups.
+func (c *Cache) resolveFamily(ctx context.Context, family, name string) ([]string, time.Duration, error) {
+	r := c.options.resolver.(FamilyResolver)
+
+	v, err, _ := c.group.Do(familyKey(name, family), func() (interface{}, error) {
+		addrs, ttl, err := r.LookupIPFamily(ctx, family, name)
+		if err != nil {
+			return nil, err
+		}
+
+		return resolveResult{addrs: addrs, ttl: clampTTL(ttl, c.options.minTTL, c.options.maxTTL)}, nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res := v.(resolveResult)
+	return res.addrs, res.ttl, nil
+}
+
+func clampTTL(ttl, minTTL, maxTTL time.Duration) time.Duration {
+	if minTTL > 0 && ttl < minTTL {
+		ttl = minTTL
+	}
+
+	if maxTTL > 0 && ttl > maxTTL {
+		ttl = maxTTL
+	}
+
+	return ttl
+}
+
 // DialContext connects to the address on the named network using the provided context.
 func (c *Cache) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
-	addrs, err := c.lookup(ctx, address)
+	addrs, err := c.lookup(ctx, network, address)
 	if err != nil {
 		return nil, err
 	}
@@ -197,12 +602,34 @@ func (c *Cache) DialContext(ctx context.Context, network, address string) (net.C
 		return c.options.dialer.DialContext(ctx, network, addrs[0])
 	}
 
+	if c.options.dialAllAddrs {
+		return c.dialAllAddrs(ctx, network, addrs)
+	}
+
 	// since we cache, do our oun randomization or we will use same
 	// address for life of cached item
 	idx := rand.Intn(len(addrs))
 	return c.options.dialer.DialContext(ctx, network, addrs[idx])
 }
 
+// dialAllAddrs attempts to dial each of addrs, in a randomized order,
+// returning the first successful connection. If every address fails,
+// the aggregated errors are returned.
+func (c *Cache) dialAllAddrs(ctx context.Context, network string, addrs []string) (net.Conn, error) {
+	var errs []error
+
+	for _, idx := range rand.Perm(len(addrs)) {
+		conn, err := c.options.dialer.DialContext(ctx, network, addrs[idx])
+		if err == nil {
+			return conn, nil
+		}
+
+		errs = append(errs, err)
+	}
+
+	return nil, errors.Join(errs...)
+}
+
 // Dial connects to the address on the named network.
 func (c *Cache) Dial(network, address string) (net.Conn, error) {
 	return c.DialContext(context.Background(), network, address)
@@ -5,6 +5,9 @@ import (
 	"errors"
 	"math/rand"
 	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -31,6 +34,12 @@ func TestDial(t *testing.T) {
 			host:          "testing123",
 			expectedError: noSuchHost,
 		},
+		{
+			name:          "resolver error",
+			host:          "testing123",
+			resolveError:  "connection refused",
+			expectedError: "connection refused",
+		},
 		{
 			name:            "single address",
 			host:            "testing123",
@@ -92,6 +101,341 @@ func TestDial(t *testing.T) {
 	}
 }
 
+func TestDialAllAddrs(t *testing.T) {
+	r := &testResolver{
+		addrs: []string{"127.0.0.1", "127.0.0.2", "127.0.0.3"},
+	}
+
+	d := &testDialer{
+		failAddrs: map[string]bool{
+			"127.0.0.1": true,
+			"127.0.0.2": true,
+		},
+	}
+
+	c := New(
+		WithTTL(time.Hour),
+		WithDialer(d),
+		WithResolver(r),
+		WithDialAllAddrs(true),
+	)
+
+	conn, err := c.Dial("tcp", "testing123")
+	require.NoError(t, err)
+
+	tc, ok := conn.(*testConn)
+	require.True(t, ok)
+	require.Equal(t, "127.0.0.3", tc.address)
+}
+
+func TestDialAllAddrsAllFail(t *testing.T) {
+	r := &testResolver{
+		addrs: []string{"127.0.0.1", "127.0.0.2"},
+	}
+
+	d := &testDialer{
+		failAddrs: map[string]bool{
+			"127.0.0.1": true,
+			"127.0.0.2": true,
+		},
+	}
+
+	c := New(
+		WithTTL(time.Hour),
+		WithDialer(d),
+		WithResolver(r),
+		WithDialAllAddrs(true),
+	)
+
+	_, err := c.Dial("tcp", "testing123")
+	require.Error(t, err)
+}
+
+func TestDialAddressFamily(t *testing.T) {
+	r := newFamilyResolver()
+	r.ip4 = []string{"127.0.0.1"}
+	r.ip6 = []string{"::1"}
+
+	c := New(
+		WithTTL(time.Hour),
+		WithDialer(&testDialer{}),
+		WithResolver(r),
+	)
+
+	conn, err := c.Dial("tcp4", "testing123")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1", conn.(*testConn).address)
+
+	conn, err = c.Dial("tcp6", "testing123")
+	require.NoError(t, err)
+	require.Equal(t, "::1", conn.(*testConn).address)
+
+	require.EqualValues(t, 1, r.callCount("ip4"))
+	require.EqualValues(t, 1, r.callCount("ip6"))
+}
+
+func TestDialAddressFamilyPreference(t *testing.T) {
+	r := newFamilyResolver()
+	r.ip4 = []string{"127.0.0.1"}
+	r.ip6 = []string{"::1"}
+
+	c := New(
+		WithTTL(time.Hour),
+		WithDialer(&testDialer{}),
+		WithResolver(r),
+		WithAddressFamily("ip6"),
+	)
+
+	addrs, err := c.lookup(context.Background(), "tcp", "testing123")
+	require.NoError(t, err)
+	require.Equal(t, []string{"::1", "127.0.0.1"}, addrs)
+}
+
+// TestDialAddressFamilyNoMatchPlainResolver covers a resolver that does
+// not implement FamilyResolver (e.g. net.DefaultResolver): dialing a
+// network that restricts to a family with no matching cached address
+// must return errNoSuchHost, not an empty, non-error address list.
+func TestDialAddressFamilyNoMatchPlainResolver(t *testing.T) {
+	r := &ttlResolver{addrs: []string{"::1"}, ttl: time.Hour}
+
+	c := New(
+		WithTTL(time.Hour),
+		WithDialer(&testDialer{}),
+		WithResolver(r),
+	)
+
+	_, err := c.Dial("tcp4", "testing123")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), noSuchHost)
+}
+
+type familyResolver struct {
+	ip4, ip6 []string
+	mu       sync.Mutex
+	calls    map[string]int32
+}
+
+func newFamilyResolver() *familyResolver {
+	return &familyResolver{calls: map[string]int32{}}
+}
+
+func (r *familyResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	return append(append([]string{}, r.ip4...), r.ip6...), nil
+}
+
+func (r *familyResolver) LookupIPFamily(ctx context.Context, family, host string) ([]string, time.Duration, error) {
+	r.mu.Lock()
+	r.calls[family]++
+	r.mu.Unlock()
+
+	switch family {
+	case "ip4":
+		return r.ip4, time.Minute, nil
+	case "ip6":
+		return r.ip6, time.Minute, nil
+	default:
+		return nil, 0, errors.New("unsupported family")
+	}
+}
+
+func (r *familyResolver) callCount(family string) int32 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.calls[family]
+}
+
+func BenchmarkGetHit(b *testing.B) {
+	c := New(
+		WithTTL(time.Hour),
+		WithDialer(&testDialer{}),
+		WithResolver(&testResolver{addrs: []string{"127.0.0.1"}}),
+	)
+
+	if _, err := c.Dial("tcp", "bench"); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			if _, ok := c.get("bench"); !ok {
+				b.Fatal("expected cache hit")
+			}
+		}
+	})
+}
+
+func BenchmarkSetEvict(b *testing.B) {
+	c := New(WithTTL(time.Hour), WithMaxItems(128))
+
+	b.ResetTimer()
+
+	i := 0
+	for pb := 0; pb < b.N; pb++ {
+		c.set(strconv.Itoa(i), []string{"127.0.0.1"}, time.Hour)
+		i++
+	}
+}
+
+func TestLookupTTLResolver(t *testing.T) {
+	orig := nowFunc
+	defer func() { nowFunc = orig }()
+
+	now := time.Unix(0, 0)
+	nowFunc = func() time.Time { return now }
+
+	r := &ttlResolver{addrs: []string{"127.0.0.1"}, ttl: time.Minute}
+
+	c := New(
+		WithDialer(&testDialer{}),
+		WithResolver(r),
+	)
+
+	_, err := c.Dial("tcp", "testing123")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, r.calls())
+
+	// still within the resolver-reported ttl
+	now = now.Add(30 * time.Second)
+	_, err = c.Dial("tcp", "testing123")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, r.calls())
+
+	// past the resolver-reported ttl
+	now = now.Add(31 * time.Second)
+	_, err = c.Dial("tcp", "testing123")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, r.calls())
+}
+
+func TestResolveTTLClamp(t *testing.T) {
+	r := &ttlResolver{addrs: []string{"127.0.0.1"}, ttl: time.Second}
+
+	c := New(
+		WithDialer(&testDialer{}),
+		WithResolver(r),
+		WithMinTTL(time.Hour),
+	)
+
+	addrs, ttl, err := c.resolve(context.Background(), "testing123")
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.1"}, addrs)
+	require.Equal(t, time.Hour, ttl)
+}
+
+type ttlResolver struct {
+	addrs []string
+	ttl   time.Duration
+	n     int32
+}
+
+func (r *ttlResolver) calls() int32 {
+	return atomic.LoadInt32(&r.n)
+}
+
+func (r *ttlResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, _, err := r.LookupHostTTL(ctx, host)
+	return addrs, err
+}
+
+func (r *ttlResolver) LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error) {
+	atomic.AddInt32(&r.n, 1)
+	return r.addrs, r.ttl, nil
+}
+
+func TestLookupSingleflight(t *testing.T) {
+	r := &blockingResolver{addrs: []string{"127.0.0.1"}}
+	r.release.Add(1)
+
+	c := New(
+		WithTTL(time.Hour),
+		WithDialer(&testDialer{}),
+		WithResolver(r),
+	)
+
+	const n = 10
+
+	var wg, entered sync.WaitGroup
+	entered.Add(n)
+
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			entered.Done()
+			_, err := c.Dial("tcp", "testing123")
+			require.NoError(t, err)
+		}()
+	}
+
+	// wait for every caller to have started, then for the leader to
+	// actually be in flight, before releasing the lookup, instead of
+	// racing a fixed sleep against goroutine scheduling. A caller that
+	// has not reached the lookup by then normally finds the result
+	// cached; this narrows, but does not close, the window in which a
+	// late caller could start a second lookup.
+	entered.Wait()
+	require.Eventually(t, func() bool { return r.calls() > 0 }, time.Second, time.Millisecond)
+
+	r.release.Done()
+	wg.Wait()
+
+	require.EqualValues(t, 1, r.calls())
+}
+
+type blockingResolver struct {
+	addrs   []string
+	n       int32
+	release sync.WaitGroup
+}
+
+func (r *blockingResolver) calls() int32 {
+	return atomic.LoadInt32(&r.n)
+}
+
+func (r *blockingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	atomic.AddInt32(&r.n, 1)
+	r.release.Wait()
+	return r.addrs, nil
+}
+
+func TestRefresh(t *testing.T) {
+	r := &countingResolver{addrs: []string{"127.0.0.1"}}
+
+	c := New(
+		WithTTL(time.Hour),
+		WithDialer(&testDialer{}),
+		WithResolver(r),
+		WithRefreshInterval(10*time.Millisecond),
+		WithLookupTimeout(time.Second),
+	)
+	defer c.Stop()
+
+	// prime the cache
+	_, err := c.Dial("tcp", "testing123")
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		return r.calls() > 1
+	}, time.Second, 10*time.Millisecond)
+
+	c.Stop()
+}
+
+type countingResolver struct {
+	addrs []string
+	n     int32
+}
+
+func (r *countingResolver) calls() int32 {
+	return atomic.LoadInt32(&r.n)
+}
+
+func (r *countingResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	atomic.AddInt32(&r.n, 1)
+	return r.addrs, nil
+}
+
 type testResolver struct {
 	err   error
 	addrs []string
@@ -102,9 +446,14 @@ func (t *testResolver) LookupHost(ctx context.Context, host string) ([]string, e
 }
 
 type testDialer struct {
+	failAddrs map[string]bool
 }
 
 func (t *testDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	if t.failAddrs[address] {
+		return nil, errors.New("dial failed")
+	}
+
 	return &testConn{address: address}, nil
 }
 
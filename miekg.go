@@ -0,0 +1,191 @@
+package dial
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/miekg/dns"
+)
+
+// MiekgResolver is a Resolver, TTLResolver and FamilyResolver backed by
+// github.com/miekg/dns. It performs raw A and AAAA queries against a
+// configured set of servers so that the actual record ttl can be
+// surfaced to the cache, instead of the fixed Options.ttl used with
+// net.DefaultResolver. Cache resolves through LookupIPFamily, since it
+// prefers FamilyResolver over TTLResolver.
+type MiekgResolver struct {
+	client  *dns.Client
+	servers []string
+}
+
+// NewMiekgResolver returns a MiekgResolver that queries the given DNS
+// servers, in order, until one answers. If no servers are given, the
+// nameservers configured in /etc/resolv.conf are used.
+func NewMiekgResolver(servers ...string) (*MiekgResolver, error) {
+	if len(servers) == 0 {
+		config, err := dns.ClientConfigFromFile("/etc/resolv.conf")
+		if err != nil {
+			return nil, fmt.Errorf("dial: reading /etc/resolv.conf: %w", err)
+		}
+
+		for _, server := range config.Servers {
+			servers = append(servers, net.JoinHostPort(server, config.Port))
+		}
+	}
+
+	if len(servers) == 0 {
+		return nil, errors.New("dial: no dns servers configured")
+	}
+
+	return &MiekgResolver{
+		client:  &dns.Client{},
+		servers: servers,
+	}, nil
+}
+
+// LookupHost implements Resolver.
+func (r *MiekgResolver) LookupHost(ctx context.Context, host string) ([]string, error) {
+	addrs, _, err := r.LookupHostTTL(ctx, host)
+	return addrs, err
+}
+
+// LookupHostTTL implements TTLResolver. It queries both A and AAAA
+// records for host and returns the smaller of the two record ttls, so
+// the cache never holds an address longer than any answer backing it
+// permits.
+func (r *MiekgResolver) LookupHostTTL(ctx context.Context, host string) ([]string, time.Duration, error) {
+	var (
+		addrs   []string
+		ttl     uint32
+		found   bool
+		lastErr error
+	)
+
+	for _, qtype := range [...]uint16{dns.TypeA, dns.TypeAAAA} {
+		a, t, err := r.lookup(ctx, host, qtype)
+		if err != nil {
+			// errNoSuchHost just means this record type does not exist;
+			// the other record type may still answer. Any other error is
+			// a resolver failure and is reported unless the other record
+			// type succeeds.
+			if lastErr == nil || !errors.Is(err, errNoSuchHost) {
+				lastErr = err
+			}
+			continue
+		}
+
+		addrs = append(addrs, a...)
+
+		if !found || t < ttl {
+			ttl = t
+			found = true
+		}
+	}
+
+	if len(addrs) == 0 {
+		if lastErr != nil && !errors.Is(lastErr, errNoSuchHost) {
+			return nil, 0, lastErr
+		}
+
+		return nil, 0, errNoSuchHost
+	}
+
+	return addrs, time.Duration(ttl) * time.Second, nil
+}
+
+// LookupIPFamily implements FamilyResolver, querying only the record
+// type for the requested family ("ip4" queries A, "ip6" queries
+// AAAA).
+func (r *MiekgResolver) LookupIPFamily(ctx context.Context, family, host string) ([]string, time.Duration, error) {
+	qtype, err := qtypeForFamily(family)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	addrs, ttl, err := r.lookup(ctx, host, qtype)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return addrs, time.Duration(ttl) * time.Second, nil
+}
+
+func qtypeForFamily(family string) (uint16, error) {
+	switch family {
+	case "ip4":
+		return dns.TypeA, nil
+	case "ip6":
+		return dns.TypeAAAA, nil
+	default:
+		return 0, fmt.Errorf("dial: unsupported address family %q", family)
+	}
+}
+
+func (r *MiekgResolver) lookup(ctx context.Context, host string, qtype uint16) ([]string, uint32, error) {
+	m := new(dns.Msg)
+	m.SetQuestion(dns.Fqdn(host), qtype)
+	m.RecursionDesired = true
+
+	var (
+		in  *dns.Msg
+		err error
+	)
+
+	for _, server := range r.servers {
+		in, _, err = r.client.ExchangeContext(ctx, m, server)
+		if err == nil {
+			break
+		}
+	}
+
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// NXDOMAIN is a legitimate answer meaning the name does not exist,
+	// and falls through to the len(addrs) == 0 case below. Any other
+	// non-success Rcode (SERVFAIL, REFUSED, ...) is a resolver failure
+	// and must not be conflated with "no such host", or it would get
+	// negatively cached as one.
+	if in.Rcode != dns.RcodeSuccess && in.Rcode != dns.RcodeNameError {
+		return nil, 0, fmt.Errorf("dial: %s: server returned %s", host, dns.RcodeToString[in.Rcode])
+	}
+
+	var (
+		addrs []string
+		ttl   uint32
+		first = true
+	)
+
+	for _, rr := range in.Answer {
+		var (
+			addr string
+			rttl uint32
+		)
+
+		switch v := rr.(type) {
+		case *dns.A:
+			addr, rttl = v.A.String(), v.Hdr.Ttl
+		case *dns.AAAA:
+			addr, rttl = v.AAAA.String(), v.Hdr.Ttl
+		default:
+			continue
+		}
+
+		addrs = append(addrs, addr)
+
+		if first || rttl < ttl {
+			ttl = rttl
+			first = false
+		}
+	}
+
+	if len(addrs) == 0 {
+		return nil, 0, errNoSuchHost
+	}
+
+	return addrs, ttl, nil
+}
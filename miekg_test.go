@@ -0,0 +1,143 @@
+package dial
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/miekg/dns"
+	"github.com/stretchr/testify/require"
+)
+
+// startTestDNSServer starts an in-process UDP DNS server backed by handler
+// and returns its address. The server is shut down when the test ends.
+func startTestDNSServer(t *testing.T, handler dns.HandlerFunc) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	srv := &dns.Server{PacketConn: conn, Handler: handler}
+
+	started := make(chan struct{})
+	srv.NotifyStartedFunc = func() { close(started) }
+
+	go func() {
+		_ = srv.ActivateAndServe()
+	}()
+
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("test dns server did not start")
+	}
+
+	t.Cleanup(func() {
+		_ = srv.Shutdown()
+	})
+
+	return conn.LocalAddr().String()
+}
+
+func aRecord(name string, ttl uint32, ip string) *dns.A {
+	return &dns.A{
+		Hdr: dns.RR_Header{Name: name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+		A:   net.ParseIP(ip),
+	}
+}
+
+func aaaaRecord(name string, ttl uint32, ip string) *dns.AAAA {
+	return &dns.AAAA{
+		Hdr:  dns.RR_Header{Name: name, Rrtype: dns.TypeAAAA, Class: dns.ClassINET, Ttl: ttl},
+		AAAA: net.ParseIP(ip),
+	}
+}
+
+func TestMiekgResolverLookupHostTTLMinOfAAndAAAA(t *testing.T) {
+	addr := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		q := req.Question[0]
+		switch q.Qtype {
+		case dns.TypeA:
+			m.Answer = append(m.Answer, aRecord(q.Name, 300, "127.0.0.1"))
+		case dns.TypeAAAA:
+			m.Answer = append(m.Answer, aaaaRecord(q.Name, 60, "::1"))
+		}
+
+		_ = w.WriteMsg(m)
+	})
+
+	r, err := NewMiekgResolver(addr)
+	require.NoError(t, err)
+
+	addrs, ttl, err := r.LookupHostTTL(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.ElementsMatch(t, []string{"127.0.0.1", "::1"}, addrs)
+	require.Equal(t, 60*time.Second, ttl)
+}
+
+func TestMiekgResolverOnlyOneRecordType(t *testing.T) {
+	addr := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+
+		q := req.Question[0]
+		if q.Qtype == dns.TypeA {
+			m.Answer = append(m.Answer, aRecord(q.Name, 120, "127.0.0.2"))
+		}
+		// AAAA queries get an empty NOERROR answer, as a resolver with no
+		// AAAA records for the name would return.
+
+		_ = w.WriteMsg(m)
+	})
+
+	r, err := NewMiekgResolver(addr)
+	require.NoError(t, err)
+
+	addrs, ttl, err := r.LookupHostTTL(context.Background(), "example.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"127.0.0.2"}, addrs)
+	require.Equal(t, 120*time.Second, ttl)
+}
+
+func TestMiekgResolverAllServersFail(t *testing.T) {
+	// nothing is listening on these addresses
+	r, err := NewMiekgResolver("127.0.0.1:1", "127.0.0.1:2")
+	require.NoError(t, err)
+
+	_, _, err = r.LookupHostTTL(context.Background(), "example.com")
+	require.Error(t, err)
+}
+
+func TestMiekgResolverEmptyAnswerIsNoSuchHost(t *testing.T) {
+	addr := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetReply(req)
+		// NOERROR with no records, as for a genuinely absent record type.
+		_ = w.WriteMsg(m)
+	})
+
+	r, err := NewMiekgResolver(addr)
+	require.NoError(t, err)
+
+	_, _, err = r.LookupHostTTL(context.Background(), "example.com")
+	require.ErrorIs(t, err, errNoSuchHost)
+}
+
+func TestMiekgResolverServerFailureIsNotNoSuchHost(t *testing.T) {
+	addr := startTestDNSServer(t, func(w dns.ResponseWriter, req *dns.Msg) {
+		m := new(dns.Msg)
+		m.SetRcode(req, dns.RcodeServerFailure)
+		_ = w.WriteMsg(m)
+	})
+
+	r, err := NewMiekgResolver(addr)
+	require.NoError(t, err)
+
+	_, _, err = r.LookupHostTTL(context.Background(), "example.com")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, errNoSuchHost)
+}